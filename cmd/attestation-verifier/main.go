@@ -0,0 +1,91 @@
+// Command attestation-verifier applies in-toto artifact rules to a single
+// attestation statement and reports the result.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/DataDog/attestation-verifier/verifier"
+)
+
+// ruleFlags collects repeated -material-rule/-product-rule flags of the
+// form "[mode:]rule text", e.g. "warn:ALLOW *" or "MATCH * WITH PRODUCTS FROM build".
+type ruleFlags []verifier.ArtifactRule
+
+func (r *ruleFlags) String() string {
+	rules := make([]string, len(*r))
+	for i, rule := range *r {
+		rules[i] = rule.Rule
+	}
+	return strings.Join(rules, ", ")
+}
+
+func (r *ruleFlags) Set(value string) error {
+	mode := verifier.EnforcementMode("")
+	rule := value
+	if m, rest, ok := strings.Cut(value, ":"); ok {
+		switch verifier.EnforcementMode(m) {
+		case verifier.ModeDeny, verifier.ModeWarn, verifier.ModeDryRun:
+			mode, rule = verifier.EnforcementMode(m), rest
+		}
+	}
+
+	*r = append(*r, verifier.ArtifactRule{Rule: rule, Mode: mode})
+	return nil
+}
+
+func main() {
+	statementPath := flag.String("statement", "", "path to the in-toto attestation Statement (JSON) to verify")
+	reportPath := flag.String("report", "", "write the JSON VerificationReport to this path")
+	layoutStep := flag.String("step", "", "layout step name this statement corresponds to, recorded in the report")
+
+	var materialRules, productRules ruleFlags
+	flag.Var(&materialRules, "material-rule", "material rule, optionally prefixed with an enforcement mode (deny, warn, dryrun); may be repeated")
+	flag.Var(&productRules, "product-rule", "product rule, optionally prefixed with an enforcement mode (deny, warn, dryrun); may be repeated")
+	flag.Parse()
+
+	if *statementPath == "" {
+		fmt.Fprintln(os.Stderr, "attestation-verifier: -statement is required")
+		os.Exit(2)
+	}
+
+	statementBytes, err := os.ReadFile(*statementPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "attestation-verifier: %s\n", err)
+		os.Exit(1)
+	}
+
+	statement := &attestationv1.Statement{}
+	if err := protojson.Unmarshal(statementBytes, statement); err != nil {
+		fmt.Fprintf(os.Stderr, "attestation-verifier: %s\n", err)
+		os.Exit(1)
+	}
+
+	report, verifyErr := verifier.VerifyArtifacts(statement, materialRules, productRules, nil, *layoutStep, verifier.MergePolicy{})
+
+	if *reportPath != "" {
+		reportBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "attestation-verifier: failed to marshal report: %s\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*reportPath, reportBytes, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "attestation-verifier: failed to write report: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if verifyErr != nil {
+		fmt.Fprintf(os.Stderr, "attestation-verifier: verification failed: %s\n", verifyErr)
+		os.Exit(1)
+	}
+
+	fmt.Println("attestation-verifier: verification passed")
+}
@@ -1,25 +1,131 @@
 package verifier
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/google/cel-go/cel"
 	linkPredicatev0 "github.com/in-toto/attestation/go/predicates/link/v0"
 	provenancePredicatev1 "github.com/in-toto/attestation/go/predicates/provenance/v1"
+	scaiPredicatev0 "github.com/in-toto/attestation/go/predicates/scai/v0"
+	vsaPredicatev1 "github.com/in-toto/attestation/go/predicates/vsa/v1"
 	attestationv1 "github.com/in-toto/attestation/go/v1"
 	"github.com/in-toto/in-toto-golang/in_toto"
+	slsaProvenanceCommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsaProvenancev02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/open-policy-agent/opa/rego"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
-func applyArtifactRules(statement *attestationv1.Statement, materialRules []string, productRules []string, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) error {
+// EnforcementMode controls what happens when a rule fails verification.
+type EnforcementMode string
+
+const (
+	// ModeDeny fails verification immediately, as all rules did previously.
+	ModeDeny EnforcementMode = "deny"
+	// ModeWarn records the failure in the VerificationReport but lets
+	// verification continue with the remaining rules.
+	ModeWarn EnforcementMode = "warn"
+	// ModeDryRun behaves like ModeWarn but is intended for rules that are
+	// still being evaluated for correctness before being promoted to deny.
+	ModeDryRun EnforcementMode = "dryrun"
+)
+
+// normalizeMode defaults an unset mode to ModeDeny, preserving the
+// historical all-or-nothing behaviour for rules that don't opt in.
+func normalizeMode(mode EnforcementMode) EnforcementMode {
+	if mode == "" {
+		return ModeDeny
+	}
+	return mode
+}
+
+// ArtifactRule pairs an in-toto artifact rule (as consumed by
+// in_toto.UnpackRule) with the enforcement mode it should be evaluated under.
+type ArtifactRule struct {
+	Rule string
+	Mode EnforcementMode
+}
+
+// Constraint is a single attribute rule evaluated against a predicate, along
+// with the policy engine and enforcement mode it should be evaluated under.
+type Constraint struct {
+	Rule           string
+	AllowIfNoClaim bool
+	Mode           EnforcementMode
+	// Engine selects the policy engine the Rule is written for, e.g.
+	// EngineCEL, EngineRego or EngineBuilderIdentity. Defaults to EngineCEL
+	// when unset.
+	Engine string
+	// Builder is the expected builder identity for a Constraint whose
+	// Engine is EngineBuilderIdentity. Rule is unused for that engine.
+	Builder *ExpectedBuilder
+}
+
+// RuleResult is a single entry in a VerificationReport, describing the
+// outcome of evaluating one rule against one layout step.
+type RuleResult struct {
+	Rule          string          `json:"rule"`
+	PredicateType string          `json:"predicateType,omitempty"`
+	LayoutStep    string          `json:"layoutStep,omitempty"`
+	Mode          EnforcementMode `json:"mode"`
+	Matched       []string        `json:"matched,omitempty"`
+	Consumed      []string        `json:"consumed,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// Passed reports whether the rule evaluated successfully.
+func (r RuleResult) Passed() bool {
+	return r.Error == ""
+}
+
+// VerificationReport accumulates the outcome of every rule evaluated during
+// a verification run, including rules at `warn` or `dryrun` scope that did
+// not cause verification to fail. It is JSON-serializable so it can be
+// surfaced through the CLI `--report` flag or consumed by API callers.
+type VerificationReport struct {
+	Results []RuleResult `json:"results"`
+}
+
+// add records a rule outcome in the report.
+func (r *VerificationReport) add(result RuleResult) {
+	r.Results = append(r.Results, result)
+}
+
+// HasDenyFailures reports whether any `deny`-scoped rule in the report
+// failed. Callers use this to tell a blocking failure apart from rules that
+// failed in `warn` or `dryrun` scope.
+func (r *VerificationReport) HasDenyFailures() bool {
+	for _, result := range r.Results {
+		if !result.Passed() && result.Mode == ModeDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyArtifacts applies materialRules and productRules to statement and
+// returns the resulting VerificationReport alongside a terminal error if any
+// deny-scoped rule failed. It is the package's entry point for callers
+// outside package verifier, including the `--report` CLI flag.
+func VerifyArtifacts(statement *attestationv1.Statement, materialRules []ArtifactRule, productRules []ArtifactRule, claims map[string]map[AttestationIdentifier]*attestationv1.Statement, layoutStep string, policy MergePolicy) (*VerificationReport, error) {
+	return applyArtifactRules(statement, materialRules, productRules, claims, layoutStep, policy)
+}
+
+func applyArtifactRules(statement *attestationv1.Statement, materialRules []ArtifactRule, productRules []ArtifactRule, claims map[string]map[AttestationIdentifier]*attestationv1.Statement, layoutStep string, policy MergePolicy) (*VerificationReport, error) {
+	report := &VerificationReport{}
+
 	materialsList, productsList, err := getMaterialsAndProducts(statement)
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	materials := map[string]*attestationv1.ResourceDescriptor{}
@@ -50,49 +156,70 @@ func applyArtifactRules(statement *attestationv1.Statement, materialRules []stri
 
 	log.Infof("Applying material rules...")
 	for _, r := range materialRules {
-		log.Infof("Evaluating rule `%s`...", r)
-		rule, err := in_toto.UnpackRule(strings.Split(r, " "))
+		log.Infof("Evaluating rule `%s`...", r.Rule)
+		mode := normalizeMode(r.Mode)
+		rule, err := in_toto.UnpackRule(strings.Split(r.Rule, " "))
 		if err != nil {
-			return err
+			return report, err
 		}
 
 		filtered := materialsPaths.Filter(path.Clean(rule["pattern"]))
+		result := RuleResult{Rule: r.Rule, PredicateType: statement.PredicateType, LayoutStep: layoutStep, Mode: mode, Matched: filtered.Slice()}
+
 		var consumed in_toto.Set
+		var ruleErr error
 		switch rule["type"] {
 		case "match":
-			consumed = applyMatchRule(rule, materials, materialsPaths, claims)
+			consumed, ruleErr = applyMatchRule(rule, materials, materialsPaths, claims, policy)
 		case "allow":
 			consumed = filtered
 		case "delete":
 			consumed = filtered.Intersection(deleted)
 		case "disallow":
 			if len(filtered) > 0 {
-				return fmt.Errorf("materials verification failed: %s disallowed by rule %s", filtered.Slice(), rule)
+				ruleErr = fmt.Errorf("materials verification failed: %s disallowed by rule %s", filtered.Slice(), rule)
 			}
 		case "require":
 			if !materialsPaths.Has(rule["pattern"]) {
-				return fmt.Errorf("materials verification failed: %s required but not found", rule["pattern"])
+				ruleErr = fmt.Errorf("materials verification failed: %s required but not found", rule["pattern"])
 			}
 		default:
-			return fmt.Errorf("invalid material rule %s", rule["type"])
+			return report, fmt.Errorf("invalid material rule %s", rule["type"])
+		}
+
+		result.Consumed = consumed.Slice()
+		if ruleErr != nil {
+			result.Error = ruleErr.Error()
+			report.add(result)
+			if mode == ModeDeny {
+				return report, ruleErr
+			}
+			log.Warnf("rule `%s` failed at %s scope: %s", r.Rule, mode, ruleErr)
+		} else {
+			report.add(result)
 		}
+
 		materialsPaths = materialsPaths.Difference(consumed)
 	}
 
 	// I've separated these out on purpose right now
 	log.Infof("Applying product rules...")
 	for _, r := range productRules {
-		log.Infof("Evaluating rule `%s`...", r)
-		rule, err := in_toto.UnpackRule(strings.Split(r, " "))
+		log.Infof("Evaluating rule `%s`...", r.Rule)
+		mode := normalizeMode(r.Mode)
+		rule, err := in_toto.UnpackRule(strings.Split(r.Rule, " "))
 		if err != nil {
-			return err
+			return report, err
 		}
 
 		filtered := productsPaths.Filter(path.Clean(rule["pattern"]))
+		result := RuleResult{Rule: r.Rule, PredicateType: statement.PredicateType, LayoutStep: layoutStep, Mode: mode, Matched: filtered.Slice()}
+
 		var consumed in_toto.Set
+		var ruleErr error
 		switch rule["type"] {
 		case "match":
-			consumed = applyMatchRule(rule, products, productsPaths, claims)
+			consumed, ruleErr = applyMatchRule(rule, products, productsPaths, claims, policy)
 		case "allow":
 			consumed = filtered
 		case "create":
@@ -101,54 +228,208 @@ func applyArtifactRules(statement *attestationv1.Statement, materialRules []stri
 			consumed = filtered.Intersection(modified)
 		case "disallow":
 			if len(filtered) > 0 {
-				return fmt.Errorf("products verification failed: %s disallowed by rule %s", filtered.Slice(), rule)
+				ruleErr = fmt.Errorf("products verification failed: %s disallowed by rule %s", filtered.Slice(), rule)
 			}
 		case "require":
 			if !productsPaths.Has(rule["pattern"]) {
-				return fmt.Errorf("products verification failed: %s required but not found", rule["pattern"])
+				ruleErr = fmt.Errorf("products verification failed: %s required but not found", rule["pattern"])
 			}
 		default:
-			return fmt.Errorf("invalid product rule %s", rule["type"])
+			return report, fmt.Errorf("invalid product rule %s", rule["type"])
 		}
+
+		result.Consumed = consumed.Slice()
+		if ruleErr != nil {
+			result.Error = ruleErr.Error()
+			report.add(result)
+			if mode == ModeDeny {
+				return report, ruleErr
+			}
+			log.Warnf("rule `%s` failed at %s scope: %s", r.Rule, mode, ruleErr)
+		} else {
+			report.add(result)
+		}
+
 		productsPaths = productsPaths.Difference(consumed)
 	}
 
-	return nil
+	return report, nil
 }
 
-func applyAttributeRules(predicateType string, predicate map[string]any, rules []Constraint) error {
+// Attribute policy engines understood by applyAttributeRules. Downstream
+// users can register additional engines with RegisterAttributeEngine.
+const (
+	EngineCEL             = "cel"
+	EngineRego            = "rego"
+	EngineBuilderIdentity = "builder-identity"
+)
+
+// attributeEngine evaluates a single Constraint against a predicate and
+// reports whether it passed. On failure it returns a human-readable
+// violation message rather than an error; err is reserved for problems
+// evaluating the rule itself (a malformed CEL expression or Rego module).
+type attributeEngine func(predicateType string, predicate map[string]any, subject []*attestationv1.ResourceDescriptor, claims map[string]any, constraint Constraint) (passed bool, violation string, err error)
+
+var attributeEngines = map[string]attributeEngine{}
+
+// RegisterAttributeEngine makes a policy engine available to Constraint.Engine
+// under the given name. It allows downstream users to plug in policy engines
+// beyond the built-in "cel" and "rego" ones.
+func RegisterAttributeEngine(name string, eval attributeEngine) {
+	attributeEngines[name] = eval
+}
+
+func init() {
+	RegisterAttributeEngine(EngineCEL, evalCELConstraint)
+	RegisterAttributeEngine(EngineRego, evalRegoConstraint)
+	RegisterAttributeEngine(EngineBuilderIdentity, evalBuilderIdentityConstraint)
+}
+
+func evalCELConstraint(predicateType string, predicate map[string]any, subject []*attestationv1.ResourceDescriptor, claims map[string]any, constraint Constraint) (bool, string, error) {
 	env, err := getCELEnvForPredicateType(predicateType)
 	if err != nil {
-		return err
+		return false, "", err
+	}
+
+	ast, issues := env.Compile(constraint.Rule)
+	if issues != nil && issues.Err() != nil {
+		return false, "", issues.Err()
+	}
+
+	prog, err := env.Program(ast)
+	if err != nil {
+		return false, "", err
+	}
+
+	out, _, err := prog.Eval(predicate)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such attribute") && constraint.AllowIfNoClaim {
+			return true, "", nil
+		}
+		return false, "", err
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, "", fmt.Errorf("unexpected result from CEL")
+	}
+	if !result {
+		return false, fmt.Sprintf("verification failed for rule '%s'", constraint.Rule), nil
+	}
+
+	return true, "", nil
+}
+
+// evalRegoConstraint evaluates constraint.Rule as a Rego module against the
+// predicate, predicateType, subject and resolved claims. It looks for a
+// `deny` set of violation messages first, falling back to an `allow`
+// boolean, mirroring how Gatekeeper ConstraintTemplates are written.
+// regoPolicyPackage matches the `package policy` declaration every Rego
+// constraint module must have, since evalRegoConstraint always queries
+// `data.policy`.
+var regoPolicyPackage = regexp.MustCompile(`(?m)^\s*package\s+policy\s*$`)
+
+func evalRegoConstraint(predicateType string, predicate map[string]any, subject []*attestationv1.ResourceDescriptor, claims map[string]any, constraint Constraint) (bool, string, error) {
+	if !regoPolicyPackage.MatchString(constraint.Rule) {
+		return false, "", fmt.Errorf("rego policy rule must declare `package policy`, got:\n%s", constraint.Rule)
+	}
+
+	ctx := context.Background()
+
+	input := map[string]any{
+		"predicate":     predicate,
+		"predicateType": predicateType,
+		"subject":       subject,
+		"claims":        claims,
+	}
+
+	r := rego.New(
+		rego.Query("data.policy"),
+		rego.Module("constraint.rego", constraint.Rule),
+	)
+
+	pq, err := r.PrepareForEval(ctx)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to prepare rego policy: %w", err)
+	}
+
+	rs, err := pq.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to evaluate rego policy: %w", err)
+	}
+
+	// An undefined result here means `data.policy` didn't resolve to
+	// anything, even though the module declares `package policy` above -
+	// e.g. a query the engine can't satisfy. Fail closed rather than
+	// silently treating a misconfigured policy as a pass.
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return false, "", fmt.Errorf("rego policy evaluation for package \"policy\" returned no result")
+	}
+
+	result, ok := rs[0].Expressions[0].Value.(map[string]interface{})
+	if !ok {
+		return false, "", fmt.Errorf("unexpected result from rego policy")
+	}
+
+	denyMsgs, hasDeny := result["deny"].([]interface{})
+	allow, hasAllow := result["allow"].(bool)
+	if !hasDeny && !hasAllow {
+		return false, "", fmt.Errorf("rego policy must define a `deny` or `allow` rule, got neither from:\n%s", constraint.Rule)
+	}
+
+	if hasDeny && len(denyMsgs) > 0 {
+		msgs := make([]string, 0, len(denyMsgs))
+		for _, m := range denyMsgs {
+			msgs = append(msgs, fmt.Sprintf("%v", m))
+		}
+		return false, strings.Join(msgs, "; "), nil
+	}
+
+	if hasAllow && !allow {
+		return false, fmt.Sprintf("rego policy denied by rule '%s'", constraint.Rule), nil
 	}
 
+	return true, "", nil
+}
+
+func applyAttributeRules(predicateType string, predicate map[string]any, subject []*attestationv1.ResourceDescriptor, claims map[string]any, rules []Constraint, layoutStep string) (*VerificationReport, error) {
+	report := &VerificationReport{}
+
 	log.Infof("Applying attribute rules...")
 	for _, r := range rules {
 		log.Infof("Evaluating rule `%s`...", r.Rule)
-		ast, issues := env.Compile(r.Rule)
-		if issues != nil && issues.Err() != nil {
-			return issues.Err()
+		mode := normalizeMode(r.Mode)
+		result := RuleResult{Rule: r.Rule, PredicateType: predicateType, LayoutStep: layoutStep, Mode: mode}
+
+		engine := r.Engine
+		if engine == "" {
+			engine = EngineCEL
 		}
 
-		prog, err := env.Program(ast)
-		if err != nil {
-			return err
+		eval, ok := attributeEngines[engine]
+		if !ok {
+			return report, fmt.Errorf("unknown policy engine %q", engine)
 		}
 
-		out, _, err := prog.Eval(predicate)
+		passed, violation, err := eval(predicateType, predicate, subject, claims, r)
 		if err != nil {
-			if strings.Contains(err.Error(), "no such attribute") && r.AllowIfNoClaim {
-				continue
-			}
+			return report, err
 		}
-		if result, ok := out.Value().(bool); !ok {
-			return fmt.Errorf("unexpected result from CEL")
-		} else if !result {
-			return fmt.Errorf("verification failed for rule '%s'", r.Rule)
+
+		if !passed {
+			result.Error = violation
+			report.add(result)
+			if mode == ModeDeny {
+				return report, errors.New(violation)
+			}
+			log.Warnf("rule `%s` failed at %s scope: %s", r.Rule, mode, violation)
+			continue
 		}
+
+		report.add(result)
 	}
 
-	return nil
+	return report, nil
 }
 
 func getMaterialsAndProducts(statement *attestationv1.Statement) ([]*attestationv1.ResourceDescriptor, []*attestationv1.ResourceDescriptor, error) {
@@ -179,23 +460,92 @@ func getMaterialsAndProducts(statement *attestationv1.Statement) ([]*attestation
 
 		return provenance.BuildDefinition.ResolvedDependencies, statement.Subject, nil
 
+	case "https://slsa.dev/provenance/v0.2":
+		provenanceBytes, err := json.Marshal(statement.Predicate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		provenance := &slsaProvenancev02.ProvenancePredicate{}
+		if err := json.Unmarshal(provenanceBytes, provenance); err != nil {
+			return nil, nil, err
+		}
+
+		return artifactsToResourceDescriptors(provenance.Materials), statement.Subject, nil
+
+	case "https://slsa.dev/verification_summary/v1":
+		vsaBytes, err := json.Marshal(statement.Predicate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		vsa := &vsaPredicatev1.VerificationSummary{}
+		if err := protojson.Unmarshal(vsaBytes, vsa); err != nil {
+			return nil, nil, err
+		}
+
+		materials := make([]*attestationv1.ResourceDescriptor, 0, len(vsa.InputAttestations))
+		for _, input := range vsa.InputAttestations {
+			materials = append(materials, &attestationv1.ResourceDescriptor{
+				Name:   input.Uri,
+				Digest: input.Digest,
+			})
+		}
+
+		return materials, statement.Subject, nil
+
+	case "https://in-toto.io/attestation/scai/v0.2":
+		scaiBytes, err := json.Marshal(statement.Predicate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		scai := &scaiPredicatev0.AttributeReport{}
+		if err := protojson.Unmarshal(scaiBytes, scai); err != nil {
+			return nil, nil, err
+		}
+
+		evidence := make([]*attestationv1.ResourceDescriptor, 0, len(scai.Attributes))
+		for _, attribute := range scai.Attributes {
+			if attribute.Evidence != nil {
+				evidence = append(evidence, attribute.Evidence)
+			}
+		}
+
+		return evidence, statement.Subject, nil
+
+	case "https://spdx.dev/Document":
+		materials, err := getSPDXMaterials(statement.Predicate.AsMap())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return materials, statement.Subject, nil
+
+	case "https://cyclonedx.org/bom":
+		materials, err := getCycloneDXMaterials(statement.Predicate.AsMap())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return materials, statement.Subject, nil
+
 	default:
 		return statement.Subject, nil, nil
 	}
 }
 
-func applyMatchRule(rule map[string]string, srcArtifacts map[string]*attestationv1.ResourceDescriptor, queue in_toto.Set, claims map[string]map[AttestationIdentifier]*attestationv1.Statement) in_toto.Set {
+func applyMatchRule(rule map[string]string, srcArtifacts map[string]*attestationv1.ResourceDescriptor, queue in_toto.Set, claims map[string]map[AttestationIdentifier]*attestationv1.Statement, policy MergePolicy) (in_toto.Set, error) {
 	consumed := in_toto.NewSet()
 
 	dstClaims, ok := claims[rule["dstName"]]
 	if !ok {
-		return consumed
+		return consumed, nil
 	}
 
-	dstMaterials, dstProducts, err := getDestinationArtifacts(dstClaims)
+	dstMaterials, dstProducts, err := getDestinationArtifacts(dstClaims, policy)
 	if err != nil {
-		// FIXME: what is the right behaviour here across claims?
-		return consumed
+		return consumed, err
 	}
 
 	var dstArtifacts map[string]*attestationv1.ResourceDescriptor
@@ -263,32 +613,180 @@ func applyMatchRule(rule map[string]string, srcArtifacts map[string]*attestation
 		consumed.Add(srcPath)
 	}
 
-	return consumed
+	return consumed, nil
 }
 
-func getDestinationArtifacts(dstClaims map[AttestationIdentifier]*attestationv1.Statement) (map[string]*attestationv1.ResourceDescriptor, map[string]*attestationv1.ResourceDescriptor, error) {
-	materials := map[string]*attestationv1.ResourceDescriptor{}
-	products := map[string]*attestationv1.ResourceDescriptor{}
+// MergePolicy controls how getDestinationArtifacts resolves disagreements
+// between claims about a destination artifact's digest.
+type MergePolicy struct {
+	// Mode is one of MergeStrict, MergeFirstWins or MergeQuorum. The zero
+	// value behaves as MergeStrict.
+	Mode string
+	// Quorum is the number of claims that must agree on a digest for it to
+	// be accepted. Only meaningful when Mode is MergeQuorum.
+	Quorum int
+}
+
+const (
+	// MergeStrict fails with a ConflictingClaimsError as soon as two claims
+	// disagree about an artifact's digest.
+	MergeStrict = "strict"
+	// MergeFirstWins keeps whichever claim's digest was observed first and
+	// ignores later disagreements.
+	MergeFirstWins = "first-wins"
+	// MergeQuorum accepts a digest once at least Quorum claims agree on it,
+	// for multi-attestor pipelines where N of M attestors must agree before
+	// a product digest is trusted.
+	MergeQuorum = "require-quorum"
+)
+
+// ConflictingClaimsError reports that two attestations disagree about the
+// digest of an artifact with the same name while merging claims about a
+// destination step.
+type ConflictingClaimsError struct {
+	ArtifactName string
+	AttestationA AttestationIdentifier
+	DigestA      map[string]string
+	AttestationB AttestationIdentifier
+	DigestB      map[string]string
+}
+
+func (e *ConflictingClaimsError) Error() string {
+	return fmt.Sprintf("conflicting claims for artifact %q: %s claims %v, %s claims %v", e.ArtifactName, e.AttestationA, e.DigestA, e.AttestationB, e.DigestB)
+}
+
+// digestKey returns a stable string representation of a digest set so it
+// can be used as a map key when tallying quorum votes.
+func digestKey(digest map[string]string) string {
+	keys := make([]string, 0, len(digest))
+	for k := range digest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+":"+digest[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// claimedArtifact is one claim's statement about a single destination
+// artifact, tagged with the attestation that made it.
+type claimedArtifact struct {
+	id       AttestationIdentifier
+	artifact *attestationv1.ResourceDescriptor
+}
+
+// resolveClaims picks a single digest for each artifact name out of every
+// claim that named it, according to policy. Claims for each name are sorted
+// by attesting identifier first, so MergeFirstWins and conflict reporting
+// are deterministic regardless of dstClaims' map iteration order, and
+// MergeQuorum's winning digest (not just its vote count) is what gets
+// returned.
+func resolveClaims(claimsByName map[string][]claimedArtifact, policy MergePolicy) (map[string]*attestationv1.ResourceDescriptor, error) {
+	resolved := map[string]*attestationv1.ResourceDescriptor{}
+
+	for name, claims := range claimsByName {
+		sort.Slice(claims, func(i, j int) bool {
+			return fmt.Sprintf("%v", claims[i].id) < fmt.Sprintf("%v", claims[j].id)
+		})
+
+		votes := map[string]int{}
+		artifactOf := map[string]*attestationv1.ResourceDescriptor{}
+		for _, c := range claims {
+			key := digestKey(c.artifact.Digest)
+			votes[key]++
+			artifactOf[key] = c.artifact
+		}
+
+		switch policy.Mode {
+		case MergeFirstWins:
+			resolved[name] = claims[0].artifact
+
+		case MergeQuorum:
+			bestKey, bestCount := winningDigest(votes)
+			if bestCount < policy.Quorum {
+				return nil, fmt.Errorf("no digest for artifact %q was claimed by the required quorum of %d attestations (best agreement: %d)", name, policy.Quorum, bestCount)
+			}
+			resolved[name] = artifactOf[bestKey]
+
+		default: // MergeStrict
+			if len(votes) > 1 {
+				return nil, conflictingClaimsError(name, claims)
+			}
+			resolved[name] = claims[0].artifact
+		}
+	}
+
+	return resolved, nil
+}
+
+// winningDigest returns the digest key with the most votes, breaking ties
+// lexicographically so the result doesn't depend on map iteration order.
+func winningDigest(votes map[string]int) (string, int) {
+	keys := make([]string, 0, len(votes))
+	for k := range votes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	for _, claim := range dstClaims {
+	var bestKey string
+	var bestCount int
+	for _, key := range keys {
+		if votes[key] > bestCount {
+			bestKey, bestCount = key, votes[key]
+		}
+	}
+	return bestKey, bestCount
+}
+
+// conflictingClaimsError builds a ConflictingClaimsError naming the first
+// two claims (in sorted order) that disagree about name's digest.
+func conflictingClaimsError(name string, claims []claimedArtifact) error {
+	for _, c := range claims[1:] {
+		if !reflect.DeepEqual(claims[0].artifact.Digest, c.artifact.Digest) {
+			return &ConflictingClaimsError{
+				ArtifactName: name,
+				AttestationA: claims[0].id,
+				DigestA:      claims[0].artifact.Digest,
+				AttestationB: c.id,
+				DigestB:      c.artifact.Digest,
+			}
+		}
+	}
+	return nil
+}
+
+func getDestinationArtifacts(dstClaims map[AttestationIdentifier]*attestationv1.Statement, policy MergePolicy) (map[string]*attestationv1.ResourceDescriptor, map[string]*attestationv1.ResourceDescriptor, error) {
+	materialClaims := map[string][]claimedArtifact{}
+	productClaims := map[string][]claimedArtifact{}
+
+	for id, claim := range dstClaims {
 		materialsList, productsList, err := getMaterialsAndProducts(claim)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		// FIXME: we're overwriting artifact info without checking if claims agree
-
 		for _, artifact := range materialsList {
-			artifact := artifact
-			materials[artifact.Name] = artifact
+			materialClaims[artifact.Name] = append(materialClaims[artifact.Name], claimedArtifact{id: id, artifact: artifact})
 		}
 
 		for _, artifact := range productsList {
-			artifact := artifact
-			products[artifact.Name] = artifact
+			productClaims[artifact.Name] = append(productClaims[artifact.Name], claimedArtifact{id: id, artifact: artifact})
 		}
 	}
 
+	materials, err := resolveClaims(materialClaims, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	products, err := resolveClaims(productClaims, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	return materials, products, nil
 }
 
@@ -317,7 +815,264 @@ func getCELEnvForPredicateType(predicateType string) (*cel.Env, error) {
 			cel.Variable("buildDefinition", cel.ObjectType("in_toto_attestation.predicates.provenance.v1.BuildDefinition")),
 			cel.Variable("runDetails", cel.ObjectType("in_toto_attestation.predicates.provenance.v1.RunDetails")),
 		)
+	case "https://slsa.dev/provenance/v0.2":
+		// The v0.2 predicate predates the typed in-toto attestation predicates
+		// and is decoded as a plain struct, so its fields are exposed as dyn
+		// rather than protobuf object types.
+		return cel.NewEnv(
+			cel.Variable("builder", cel.DynType),
+			cel.Variable("buildType", cel.StringType),
+			cel.Variable("invocation", cel.DynType),
+			cel.Variable("buildConfig", cel.DynType),
+			cel.Variable("metadata", cel.DynType),
+			cel.Variable("materials", cel.ListType(cel.DynType)),
+		)
+	case "https://slsa.dev/verification_summary/v1":
+		return cel.NewEnv(
+			cel.Variable("verifier", cel.ObjectType("in_toto_attestation.predicates.vsa.v1.Verifier")),
+			cel.Variable("timeVerified", cel.StringType),
+			cel.Variable("resourceUri", cel.StringType),
+			cel.Variable("policy", cel.DynType),
+			cel.Variable("inputAttestations", cel.ListType(cel.ObjectType("in_toto_attestation.v1.ResourceDescriptor"))),
+			cel.Variable("verificationResult", cel.StringType),
+			cel.Variable("verifiedLevels", cel.ListType(cel.StringType)),
+		)
+	case "https://in-toto.io/attestation/scai/v0.2":
+		return cel.NewEnv(
+			cel.Variable("attributes", cel.ListType(cel.DynType)),
+		)
+	case "https://spdx.dev/Document":
+		return cel.NewEnv(
+			cel.Variable("packages", cel.ListType(cel.DynType)),
+			cel.Variable("relationships", cel.ListType(cel.DynType)),
+		)
+	case "https://cyclonedx.org/bom":
+		return cel.NewEnv(
+			cel.Variable("components", cel.ListType(cel.DynType)),
+			cel.Variable("dependencies", cel.ListType(cel.DynType)),
+		)
 	}
 
 	return nil, fmt.Errorf("unknown predicate type")
 }
+
+// artifactsToResourceDescriptors converts the plain-struct artifacts used by
+// legacy predicates such as SLSA provenance v0.2 into the ResourceDescriptors
+// used throughout the rest of the verifier.
+func artifactsToResourceDescriptors(artifacts []slsaProvenanceCommon.ProvenanceMaterial) []*attestationv1.ResourceDescriptor {
+	descriptors := make([]*attestationv1.ResourceDescriptor, 0, len(artifacts))
+	for _, a := range artifacts {
+		descriptors = append(descriptors, &attestationv1.ResourceDescriptor{
+			Name:   a.URI,
+			Digest: a.Digest,
+		})
+	}
+	return descriptors
+}
+
+// getSPDXMaterials extracts an SPDX document's packages as materials. SPDX
+// has no protobuf schema in the in-toto attestation framework, so it is
+// walked as a generic JSON document instead.
+func getSPDXMaterials(predicate map[string]any) ([]*attestationv1.ResourceDescriptor, error) {
+	packages, _ := predicate["packages"].([]any)
+	descriptors := make([]*attestationv1.ResourceDescriptor, 0, len(packages))
+
+	for _, p := range packages {
+		pkg, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		name, _ := pkg["name"].(string)
+		digest := map[string]string{}
+		if checksums, ok := pkg["checksums"].([]any); ok {
+			for _, c := range checksums {
+				checksum, ok := c.(map[string]any)
+				if !ok {
+					continue
+				}
+				algorithm, _ := checksum["algorithm"].(string)
+				value, _ := checksum["checksumValue"].(string)
+				if algorithm != "" && value != "" {
+					digest[strings.ToLower(algorithm)] = value
+				}
+			}
+		}
+
+		descriptors = append(descriptors, &attestationv1.ResourceDescriptor{Name: name, Digest: digest})
+	}
+
+	return descriptors, nil
+}
+
+// getCycloneDXMaterials extracts a CycloneDX BOM's components as materials.
+// Like SPDX, CycloneDX has no protobuf schema in the in-toto attestation
+// framework, so it is walked as a generic JSON document instead.
+func getCycloneDXMaterials(predicate map[string]any) ([]*attestationv1.ResourceDescriptor, error) {
+	components, _ := predicate["components"].([]any)
+	descriptors := make([]*attestationv1.ResourceDescriptor, 0, len(components))
+
+	for _, c := range components {
+		component, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		name, _ := component["name"].(string)
+		digest := map[string]string{}
+		if hashes, ok := component["hashes"].([]any); ok {
+			for _, h := range hashes {
+				hash, ok := h.(map[string]any)
+				if !ok {
+					continue
+				}
+				algorithm, _ := hash["alg"].(string)
+				content, _ := hash["content"].(string)
+				if algorithm != "" && content != "" {
+					digest[strings.ToLower(strings.ReplaceAll(algorithm, "-", ""))] = content
+				}
+			}
+		}
+
+		descriptors = append(descriptors, &attestationv1.ResourceDescriptor{Name: name, Digest: digest})
+	}
+
+	return descriptors, nil
+}
+
+// ExpectedBuilder describes the builder identity a SLSA provenance
+// attestation must be signed by. Fields left empty are not checked.
+type ExpectedBuilder struct {
+	// ID is matched exactly against runDetails.builder.id.
+	ID string
+	// SourceRepoURI is matched, after normalization, against the workflow
+	// repository recorded in buildDefinition.externalParameters.workflow
+	// and against the resolvedDependencies entry for that source.
+	SourceRepoURI string
+	// RefPattern is a regular expression matched against the full workflow
+	// ref; it is implicitly anchored at both ends, e.g. `refs/tags/v1\.2\.3`
+	// matches only that exact ref, not a ref containing it as a substring.
+	RefPattern string
+	// WorkflowPath is matched exactly against the workflow path.
+	WorkflowPath string
+}
+
+// BuilderIdentityError reports that a SLSA provenance attestation's builder
+// identity did not match an ExpectedBuilder. Callers can type-assert for
+// *BuilderIdentityError to distinguish identity failures from artifact-rule
+// failures.
+type BuilderIdentityError struct {
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (e *BuilderIdentityError) Error() string {
+	return fmt.Sprintf("builder identity verification failed: %s expected %q, got %q", e.Field, e.Expected, e.Actual)
+}
+
+// verifyBuilderIdentity checks the builder identity fields of a SLSA
+// provenance/v1 predicate against expected. It closes the gap where CEL
+// rules could inspect these fields but there was no canonical, testable
+// primitive for "this artifact must be built by workflow X in repo Y at
+// ref matching Z".
+// evalBuilderIdentityConstraint adapts verifyBuilderIdentity to the
+// attributeEngine interface, so a Constraint with Engine: EngineBuilderIdentity
+// participates in enforcement-mode scoping and VerificationReport like any
+// other attribute rule.
+func evalBuilderIdentityConstraint(predicateType string, predicate map[string]any, subject []*attestationv1.ResourceDescriptor, claims map[string]any, constraint Constraint) (bool, string, error) {
+	if constraint.Builder == nil {
+		return false, "", fmt.Errorf("constraint uses engine %q but has no Builder configured", EngineBuilderIdentity)
+	}
+
+	err := verifyBuilderIdentity(predicateType, predicate, *constraint.Builder)
+	if err == nil {
+		return true, "", nil
+	}
+
+	var identityErr *BuilderIdentityError
+	if errors.As(err, &identityErr) {
+		return false, identityErr.Error(), nil
+	}
+
+	return false, "", err
+}
+
+func verifyBuilderIdentity(predicateType string, predicate map[string]any, expected ExpectedBuilder) error {
+	if predicateType != "https://slsa.dev/provenance/v1" {
+		return fmt.Errorf("builder identity verification requires predicate type \"https://slsa.dev/provenance/v1\", got %q", predicateType)
+	}
+
+	provenanceBytes, err := json.Marshal(predicate)
+	if err != nil {
+		return err
+	}
+
+	provenance := &provenancePredicatev1.Provenance{}
+	if err := protojson.Unmarshal(provenanceBytes, provenance); err != nil {
+		return err
+	}
+
+	if expected.ID != "" {
+		builderID := provenance.GetRunDetails().GetBuilder().GetId()
+		if builderID != expected.ID {
+			return &BuilderIdentityError{Field: "runDetails.builder.id", Expected: expected.ID, Actual: builderID}
+		}
+	}
+
+	workflow, _ := provenance.GetBuildDefinition().GetExternalParameters().AsMap()["workflow"].(map[string]any)
+
+	if expected.SourceRepoURI != "" {
+		repo, _ := workflow["repository"].(string)
+		if normalizeRepoURI(repo) != normalizeRepoURI(expected.SourceRepoURI) {
+			return &BuilderIdentityError{Field: "buildDefinition.externalParameters.workflow.repository", Expected: expected.SourceRepoURI, Actual: repo}
+		}
+
+		if !resolvedDependenciesContainSource(provenance.GetBuildDefinition().GetResolvedDependencies(), expected.SourceRepoURI) {
+			return &BuilderIdentityError{Field: "buildDefinition.resolvedDependencies", Expected: expected.SourceRepoURI, Actual: "not found"}
+		}
+	}
+
+	if expected.WorkflowPath != "" {
+		workflowPath, _ := workflow["path"].(string)
+		if workflowPath != expected.WorkflowPath {
+			return &BuilderIdentityError{Field: "buildDefinition.externalParameters.workflow.path", Expected: expected.WorkflowPath, Actual: workflowPath}
+		}
+	}
+
+	if expected.RefPattern != "" {
+		ref, _ := workflow["ref"].(string)
+		refPattern, err := regexp.Compile("^(?:" + expected.RefPattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid builder ref pattern %q: %w", expected.RefPattern, err)
+		}
+		if !refPattern.MatchString(ref) {
+			return &BuilderIdentityError{Field: "buildDefinition.externalParameters.workflow.ref", Expected: expected.RefPattern, Actual: ref}
+		}
+	}
+
+	return nil
+}
+
+// resolvedDependenciesContainSource reports whether deps contains an entry
+// for the workflow's own source repository, as recorded by the builder
+// alongside the other build materials.
+func resolvedDependenciesContainSource(deps []*attestationv1.ResourceDescriptor, sourceRepoURI string) bool {
+	normalizedExpected := normalizeRepoURI(sourceRepoURI)
+	for _, dep := range deps {
+		if normalizeRepoURI(dep.GetName()) == normalizedExpected || normalizeRepoURI(dep.GetUri()) == normalizedExpected {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRepoURI strips the variations GitHub Actions and other builders
+// use when recording a source repository URI (a `git+` scheme prefix and a
+// trailing `.git` or `/`) so that equivalent URIs compare equal.
+func normalizeRepoURI(uri string) string {
+	uri = strings.TrimPrefix(uri, "git+")
+	uri = strings.TrimSuffix(uri, ".git")
+	uri = strings.TrimSuffix(uri, "/")
+	return uri
+}
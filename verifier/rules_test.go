@@ -0,0 +1,451 @@
+package verifier
+
+import (
+	"errors"
+	"testing"
+
+	attestationv1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func mustStruct(t *testing.T, m map[string]any) *structpb.Struct {
+	t.Helper()
+
+	s, err := structpb.NewStruct(m)
+	if err != nil {
+		t.Fatalf("failed to build predicate struct: %s", err)
+	}
+	return s
+}
+
+func TestGetMaterialsAndProductsProvenanceV02(t *testing.T) {
+	statement := &attestationv1.Statement{
+		PredicateType: "https://slsa.dev/provenance/v0.2",
+		Predicate: mustStruct(t, map[string]any{
+			"materials": []any{
+				map[string]any{
+					"uri":    "git+https://github.com/example/repo",
+					"digest": map[string]any{"sha256": "abc123"},
+				},
+			},
+		}),
+	}
+
+	materials, products, err := getMaterialsAndProducts(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(materials) != 1 {
+		t.Fatalf("expected 1 material, got %d", len(materials))
+	}
+	if materials[0].Name != "git+https://github.com/example/repo" {
+		t.Errorf("unexpected material name: %s", materials[0].Name)
+	}
+	if materials[0].Digest["sha256"] != "abc123" {
+		t.Errorf("unexpected material digest: %v", materials[0].Digest)
+	}
+	if len(products) != 0 {
+		t.Errorf("expected no products, got %d", len(products))
+	}
+}
+
+func TestGetMaterialsAndProductsVerificationSummary(t *testing.T) {
+	statement := &attestationv1.Statement{
+		PredicateType: "https://slsa.dev/verification_summary/v1",
+		Predicate: mustStruct(t, map[string]any{
+			"inputAttestations": []any{
+				map[string]any{
+					"uri":    "provenance.json",
+					"digest": map[string]any{"sha256": "def456"},
+				},
+			},
+		}),
+	}
+
+	materials, _, err := getMaterialsAndProducts(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(materials) != 1 {
+		t.Fatalf("expected 1 material, got %d", len(materials))
+	}
+	if materials[0].Name != "provenance.json" {
+		t.Errorf("unexpected material name: %s", materials[0].Name)
+	}
+	if materials[0].Digest["sha256"] != "def456" {
+		t.Errorf("unexpected material digest: %v", materials[0].Digest)
+	}
+}
+
+func TestGetMaterialsAndProductsSCAI(t *testing.T) {
+	statement := &attestationv1.Statement{
+		PredicateType: "https://in-toto.io/attestation/scai/v0.2",
+		Predicate: mustStruct(t, map[string]any{
+			"attributes": []any{
+				map[string]any{
+					"attribute": "BUILD_LEVEL",
+					"evidence": map[string]any{
+						"name":   "evidence.json",
+						"digest": map[string]any{"sha256": "111222"},
+					},
+				},
+			},
+		}),
+	}
+
+	materials, _, err := getMaterialsAndProducts(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(materials) != 1 {
+		t.Fatalf("expected 1 material, got %d", len(materials))
+	}
+	if materials[0].Name != "evidence.json" {
+		t.Errorf("unexpected material name: %s", materials[0].Name)
+	}
+}
+
+func TestGetMaterialsAndProductsSPDX(t *testing.T) {
+	statement := &attestationv1.Statement{
+		PredicateType: "https://spdx.dev/Document",
+		Predicate: mustStruct(t, map[string]any{
+			"packages": []any{
+				map[string]any{
+					"name": "left-pad",
+					"checksums": []any{
+						map[string]any{"algorithm": "SHA256", "checksumValue": "aaa111"},
+					},
+				},
+			},
+		}),
+	}
+
+	materials, _, err := getMaterialsAndProducts(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(materials) != 1 {
+		t.Fatalf("expected 1 material, got %d", len(materials))
+	}
+	if materials[0].Name != "left-pad" {
+		t.Errorf("unexpected material name: %s", materials[0].Name)
+	}
+	if materials[0].Digest["sha256"] != "aaa111" {
+		t.Errorf("unexpected material digest: %v", materials[0].Digest)
+	}
+}
+
+func TestGetMaterialsAndProductsCycloneDX(t *testing.T) {
+	statement := &attestationv1.Statement{
+		PredicateType: "https://cyclonedx.org/bom",
+		Predicate: mustStruct(t, map[string]any{
+			"components": []any{
+				map[string]any{
+					"name": "requests",
+					"hashes": []any{
+						map[string]any{"alg": "SHA-256", "content": "bbb222"},
+					},
+				},
+			},
+		}),
+	}
+
+	materials, _, err := getMaterialsAndProducts(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(materials) != 1 {
+		t.Fatalf("expected 1 material, got %d", len(materials))
+	}
+	if materials[0].Name != "requests" {
+		t.Errorf("unexpected material name: %s", materials[0].Name)
+	}
+	if materials[0].Digest["sha256"] != "bbb222" {
+		t.Errorf("unexpected material digest: %v", materials[0].Digest)
+	}
+}
+
+func TestGetCELEnvForPredicateTypeNewTypes(t *testing.T) {
+	for _, predicateType := range []string{
+		"https://slsa.dev/provenance/v0.2",
+		"https://slsa.dev/verification_summary/v1",
+		"https://in-toto.io/attestation/scai/v0.2",
+		"https://spdx.dev/Document",
+		"https://cyclonedx.org/bom",
+	} {
+		t.Run(predicateType, func(t *testing.T) {
+			env, err := getCELEnvForPredicateType(predicateType)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if env == nil {
+				t.Fatal("expected a non-nil CEL environment")
+			}
+		})
+	}
+}
+
+func TestApplyAttributeRulesWarnContinuesAndRecordsFailure(t *testing.T) {
+	predicate := map[string]any{"attributes": []any{}}
+	rules := []Constraint{
+		{Rule: "size(attributes) > 0", Mode: ModeWarn},
+	}
+
+	report, err := applyAttributeRules("https://in-toto.io/attestation/scai/v0.2", predicate, nil, nil, rules, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(report.Results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(report.Results))
+	}
+	if report.Results[0].Passed() {
+		t.Errorf("expected the rule to be recorded as failed")
+	}
+	if report.HasDenyFailures() {
+		t.Errorf("a warn-scoped failure must not count as a deny failure")
+	}
+}
+
+func TestApplyAttributeRulesDenyStopsAndReportsFailure(t *testing.T) {
+	predicate := map[string]any{"attributes": []any{}}
+	rules := []Constraint{
+		{Rule: "size(attributes) > 0", Mode: ModeDryRun},
+		{Rule: "size(attributes) > 0", Mode: ModeDeny},
+	}
+
+	report, err := applyAttributeRules("https://in-toto.io/attestation/scai/v0.2", predicate, nil, nil, rules, "")
+	if err == nil {
+		t.Fatal("expected a deny-scoped failure to return an error")
+	}
+
+	if len(report.Results) != 2 {
+		t.Fatalf("expected both rules to be recorded before returning, got %d", len(report.Results))
+	}
+	if report.Results[0].Mode != ModeDryRun || report.Results[0].Passed() {
+		t.Errorf("expected the dryrun rule to be recorded as failed: %+v", report.Results[0])
+	}
+	if !report.HasDenyFailures() {
+		t.Errorf("expected HasDenyFailures to report the deny-scoped failure")
+	}
+}
+
+func TestEvalRegoConstraintAllow(t *testing.T) {
+	passed, violation, err := evalRegoConstraint("", nil, nil, nil, Constraint{Rule: "package policy\n\ndefault allow := true\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !passed {
+		t.Errorf("expected allow := true to pass, got violation %q", violation)
+	}
+}
+
+func TestEvalRegoConstraintDeny(t *testing.T) {
+	passed, violation, err := evalRegoConstraint("", nil, nil, nil, Constraint{Rule: "package policy\nimport rego.v1\n\ndeny contains \"not allowed\" if true\n"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if passed {
+		t.Errorf("expected a deny rule to fail the constraint")
+	}
+	if violation == "" {
+		t.Errorf("expected a violation message from the deny rule")
+	}
+}
+
+func TestEvalRegoConstraintMissingPackageDeclaration(t *testing.T) {
+	_, _, err := evalRegoConstraint("", nil, nil, nil, Constraint{Rule: "package other\n\ndefault allow := true\n"})
+	if err == nil {
+		t.Fatal("expected an error for a module that doesn't declare package policy")
+	}
+}
+
+func TestEvalRegoConstraintNoDenyOrAllowRuleFailsClosed(t *testing.T) {
+	_, _, err := evalRegoConstraint("", nil, nil, nil, Constraint{Rule: "package policy\n\nsome_other_rule := true\n"})
+	if err == nil {
+		t.Fatal("expected an error when the module defines neither deny nor allow")
+	}
+}
+
+func provenanceV1Predicate(t *testing.T, repository, ref, workflowPath, builderID string) map[string]any {
+	t.Helper()
+
+	return map[string]any{
+		"buildDefinition": map[string]any{
+			"externalParameters": map[string]any{
+				"workflow": map[string]any{
+					"repository": repository,
+					"ref":        ref,
+					"path":       workflowPath,
+				},
+			},
+			"resolvedDependencies": []any{
+				map[string]any{"uri": repository, "digest": map[string]any{"sha256": "abc123"}},
+			},
+		},
+		"runDetails": map[string]any{
+			"builder": map[string]any{"id": builderID},
+		},
+	}
+}
+
+func TestVerifyBuilderIdentity(t *testing.T) {
+	predicate := provenanceV1Predicate(t, "git+https://github.com/example/repo", "refs/tags/v1.2.3", ".github/workflows/release.yml", "https://github.com/example/builder")
+
+	tests := []struct {
+		name      string
+		expected  ExpectedBuilder
+		wantField string
+	}{
+		{name: "all fields match", expected: ExpectedBuilder{
+			ID:            "https://github.com/example/builder",
+			SourceRepoURI: "https://github.com/example/repo",
+			RefPattern:    `refs/tags/v1\.2\.3`,
+			WorkflowPath:  ".github/workflows/release.yml",
+		}},
+		{name: "id mismatch", expected: ExpectedBuilder{ID: "https://github.com/other/builder"}, wantField: "runDetails.builder.id"},
+		{name: "source repo mismatch", expected: ExpectedBuilder{SourceRepoURI: "https://github.com/other/repo"}, wantField: "buildDefinition.externalParameters.workflow.repository"},
+		{name: "workflow path mismatch", expected: ExpectedBuilder{WorkflowPath: "other.yml"}, wantField: "buildDefinition.externalParameters.workflow.path"},
+		{name: "ref pattern mismatch", expected: ExpectedBuilder{RefPattern: `refs/tags/v2\..*`}, wantField: "buildDefinition.externalParameters.workflow.ref"},
+		{
+			name:      "ref pattern does not match a ref that merely contains it as a substring",
+			expected:  ExpectedBuilder{RefPattern: `refs/tags/v1\.2\.3`},
+			wantField: "buildDefinition.externalParameters.workflow.ref",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pred := predicate
+			if tt.name == "ref pattern does not match a ref that merely contains it as a substring" {
+				pred = provenanceV1Predicate(t, "git+https://github.com/example/repo", "refs/heads/evil/refs/tags/v1.2.3-backdoor", ".github/workflows/release.yml", "https://github.com/example/builder")
+			}
+
+			err := verifyBuilderIdentity("https://slsa.dev/provenance/v1", pred, tt.expected)
+
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			var identityErr *BuilderIdentityError
+			if !errors.As(err, &identityErr) {
+				t.Fatalf("expected a *BuilderIdentityError, got %v", err)
+			}
+			if identityErr.Field != tt.wantField {
+				t.Errorf("expected mismatch on field %q, got %q", tt.wantField, identityErr.Field)
+			}
+		})
+	}
+}
+
+func TestVerifyBuilderIdentityWrongPredicateType(t *testing.T) {
+	err := verifyBuilderIdentity("https://slsa.dev/provenance/v0.2", map[string]any{}, ExpectedBuilder{ID: "anything"})
+	if err == nil {
+		t.Fatal("expected an error for a non-provenance/v1 predicate type")
+	}
+}
+
+func claim(id AttestationIdentifier, sha256 string) claimedArtifact {
+	return claimedArtifact{id: id, artifact: &attestationv1.ResourceDescriptor{Name: "out", Digest: map[string]string{"sha256": sha256}}}
+}
+
+func TestResolveClaimsStrictAgreement(t *testing.T) {
+	claimsByName := map[string][]claimedArtifact{
+		"out": {claim("b", "abc"), claim("a", "abc")},
+	}
+
+	resolved, err := resolveClaims(claimsByName, MergePolicy{Mode: MergeStrict})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resolved["out"].Digest["sha256"] != "abc" {
+		t.Errorf("unexpected resolved digest: %v", resolved["out"].Digest)
+	}
+}
+
+func TestResolveClaimsStrictConflictIsDeterministic(t *testing.T) {
+	claimsByName := map[string][]claimedArtifact{
+		"out": {claim("z", "zzz"), claim("a", "aaa")},
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := resolveClaims(claimsByName, MergePolicy{Mode: MergeStrict})
+		var conflictErr *ConflictingClaimsError
+		if !errors.As(err, &conflictErr) {
+			t.Fatalf("expected a *ConflictingClaimsError, got %v", err)
+		}
+		if conflictErr.AttestationA != "a" || conflictErr.AttestationB != "z" {
+			t.Fatalf("expected conflict ordered by attesting identifier (a, z), got (%s, %s)", conflictErr.AttestationA, conflictErr.AttestationB)
+		}
+	}
+}
+
+func TestResolveClaimsFirstWinsIsDeterministic(t *testing.T) {
+	// claims are listed out of sorted order here; resolveClaims must sort by
+	// attesting identifier itself rather than trusting insertion order.
+	claimsByName := map[string][]claimedArtifact{
+		"out": {claim("z", "zzz"), claim("a", "aaa")},
+	}
+
+	for i := 0; i < 10; i++ {
+		resolved, err := resolveClaims(claimsByName, MergePolicy{Mode: MergeFirstWins})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if resolved["out"].Digest["sha256"] != "aaa" {
+			t.Fatalf("expected the claim from the lowest-sorted attestation id to win, got %v", resolved["out"].Digest)
+		}
+	}
+}
+
+func TestResolveClaimsQuorumPreservesWinningArtifact(t *testing.T) {
+	winner := &attestationv1.ResourceDescriptor{Name: "out", Uri: "pkg:generic/out", Digest: map[string]string{"sha256": "aaa"}}
+	claimsByName := map[string][]claimedArtifact{
+		"out": {
+			{id: "a", artifact: winner},
+			{id: "b", artifact: &attestationv1.ResourceDescriptor{Name: "out", Uri: "pkg:generic/out", Digest: map[string]string{"sha256": "aaa"}}},
+			{id: "c", artifact: &attestationv1.ResourceDescriptor{Name: "out", Digest: map[string]string{"sha256": "ccc"}}},
+		},
+	}
+
+	resolved, err := resolveClaims(claimsByName, MergePolicy{Mode: MergeQuorum, Quorum: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resolved["out"].Uri != "pkg:generic/out" {
+		t.Errorf("expected the winning claim's full descriptor to be preserved, got Uri %q", resolved["out"].Uri)
+	}
+}
+
+func TestResolveClaimsQuorumAccepted(t *testing.T) {
+	claimsByName := map[string][]claimedArtifact{
+		"out": {claim("a", "aaa"), claim("b", "aaa"), claim("c", "ccc")},
+	}
+
+	resolved, err := resolveClaims(claimsByName, MergePolicy{Mode: MergeQuorum, Quorum: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resolved["out"].Digest["sha256"] != "aaa" {
+		t.Errorf("expected the digest with quorum votes to win, got %v", resolved["out"].Digest)
+	}
+}
+
+func TestResolveClaimsQuorumNotMet(t *testing.T) {
+	claimsByName := map[string][]claimedArtifact{
+		"out": {claim("a", "aaa"), claim("b", "bbb"), claim("c", "ccc")},
+	}
+
+	_, err := resolveClaims(claimsByName, MergePolicy{Mode: MergeQuorum, Quorum: 2})
+	if err == nil {
+		t.Fatal("expected an error when no digest reaches the required quorum")
+	}
+}